@@ -0,0 +1,190 @@
+package edit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xiaq/elvish/eval"
+)
+
+// modeNames maps between bufferMode and the mode names used in Elvish
+// script, e.g. by edit:bind's first argument.
+var modeNames = map[bufferMode]string{
+	modeInsert:         "insert",
+	modeCommand:        "command",
+	modeCompletion:     "completion",
+	modeNavigation:     "navigation",
+	modeHistory:        "history",
+	modeHistoryListing: "history-listing",
+}
+
+func modeByName(name string) (bufferMode, error) {
+	for m, n := range modeNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("no such editor mode: %q", name)
+}
+
+// namespace builds the edit: namespace made available to closures bound
+// via edit:bind, giving them read access to the state of the editor that
+// invoked them and a way to modify the command line.
+func (ed *Editor) namespace() map[string]eval.Value {
+	return map[string]eval.Value{
+		"line": eval.String(ed.line),
+		"dot":  eval.String(strconv.Itoa(ed.dot)),
+		"mode": eval.String(modeNames[ed.mode]),
+		eval.FnPrefix + "insert-at-dot": &eval.BuiltinFn{
+			Name: "edit:insert-at-dot", Impl: ed.editInsertAtDot,
+		},
+	}
+}
+
+func (ed *Editor) editInsertAtDot(ctx *eval.EvalCtx, args []eval.Value, opts map[string]eval.Value) (eval.Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("edit:insert-at-dot takes exactly 1 argument: text")
+	}
+	text, ok := args[0].(eval.String)
+	if !ok {
+		return nil, fmt.Errorf("edit:insert-at-dot argument must be a string")
+	}
+	s := string(text)
+	ed.line = ed.line[:ed.dot] + s + ed.line[ed.dot:]
+	ed.dot += len(s)
+	return nil, nil
+}
+
+// editBind implements edit:bind: edit:bind mode key action, where action
+// is either the name of a builtin or a closure.
+func (ed *Editor) editBind(ctx *eval.EvalCtx, args []eval.Value, opts map[string]eval.Value) (eval.Value, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("edit:bind takes exactly 3 arguments: mode, key and action")
+	}
+	mode, err := modeArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	k, err := keyArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if name, ok := args[2].(eval.String); ok {
+		return nil, ed.Bind(mode, k, string(name))
+	}
+	ed.BindClosure(mode, k, args[2])
+	return nil, nil
+}
+
+// editUnbind implements edit:unbind: edit:unbind mode key.
+func (ed *Editor) editUnbind(ctx *eval.EvalCtx, args []eval.Value, opts map[string]eval.Value) (eval.Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("edit:unbind takes exactly 2 arguments: mode and key")
+	}
+	mode, err := modeArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	k, err := keyArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	ed.Unbind(mode, k)
+	return nil, nil
+}
+
+// editBinding implements edit:binding: edit:binding mode key, returning
+// what the key currently resolves to.
+func (ed *Editor) editBinding(ctx *eval.EvalCtx, args []eval.Value, opts map[string]eval.Value) (eval.Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("edit:binding takes exactly 2 arguments: mode and key")
+	}
+	mode, err := modeArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+	k, err := keyArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return eval.String(ed.Binding(mode, k)), nil
+}
+
+func modeArg(v eval.Value) (bufferMode, error) {
+	s, ok := v.(eval.String)
+	if !ok {
+		return 0, fmt.Errorf("mode argument must be a string")
+	}
+	return modeByName(string(s))
+}
+
+func keyArg(v eval.Value) (Key, error) {
+	s, ok := v.(eval.String)
+	if !ok {
+		return Key{}, fmt.Errorf("key argument must be a string")
+	}
+	return parseKey(string(s))
+}
+
+// modKeys maps modifier names, as used in a "Mod-X" key spec, to their Mod
+// value.
+var modKeys = map[string]int{
+	"Ctrl": Ctrl,
+	"Alt":  Alt,
+}
+
+// namedKeys maps the name of a non-character key, as used in a key spec,
+// to its rune value.
+var namedKeys = map[string]rune{
+	"Backspace": Backspace,
+	"Delete":    Delete,
+	"Left":      Left,
+	"Right":     Right,
+	"Up":        Up,
+	"Down":      Down,
+	"Enter":     Enter,
+	"Tab":       Tab,
+	"PageUp":    PageUp,
+	"PageDown":  PageDown,
+}
+
+// parseKey parses a key spec such as "i", "Enter", "Ctrl-R" or "Alt-Enter"
+// into a Key, for use by edit:bind, edit:unbind and edit:binding.
+func parseKey(spec string) (Key, error) {
+	parts := strings.Split(spec, "-")
+	mod := 0
+	for _, p := range parts[:len(parts)-1] {
+		m, ok := modKeys[p]
+		if !ok {
+			return Key{}, fmt.Errorf("unknown key modifier: %q", p)
+		}
+		mod |= m
+	}
+	last := parts[len(parts)-1]
+	if r, ok := namedKeys[last]; ok {
+		return Key{r, mod}, nil
+	}
+	runes := []rune(last)
+	if len(runes) != 1 {
+		return Key{}, fmt.Errorf("invalid key: %q", spec)
+	}
+	return Key{runes[0], mod}, nil
+}
+
+// registerEditBuiltins installs edit:bind, edit:unbind and edit:binding
+// into ed's "edit" module namespace, following the same convention other
+// modules use (see goodFormHead's lookup in highlight.go): functions live
+// under their name prefixed with eval.FnPrefix. ed.ev's "edit" entry is
+// private to ed (see forkModules in editor.go), so this is safe even when
+// ed.ev is shared with other Editors.
+func (ed *Editor) registerEditBuiltins() {
+	ns := ed.ev.Modules["edit"]
+	if ns == nil {
+		ns = map[string]eval.Value{}
+		ed.ev.Modules["edit"] = ns
+	}
+	ns[eval.FnPrefix+"bind"] = &eval.BuiltinFn{Name: "edit:bind", Impl: ed.editBind}
+	ns[eval.FnPrefix+"unbind"] = &eval.BuiltinFn{Name: "edit:unbind", Impl: ed.editUnbind}
+	ns[eval.FnPrefix+"binding"] = &eval.BuiltinFn{Name: "edit:binding", Impl: ed.editBinding}
+}
@@ -0,0 +1,100 @@
+package edit
+
+import (
+	"fmt"
+
+	"github.com/xiaq/elvish/eval"
+)
+
+// binding is what a single key resolves to in a bindingTable: either the
+// name of a builtin registered in leBuiltins, or an arbitrary Elvish
+// closure to call directly, letting users write their own editing
+// commands in rc.elv instead of being limited to named builtins.
+type binding struct {
+	name    string
+	closure eval.Value
+}
+
+// bindingTable is Editor's runtime, per-session replacement for the old
+// package-level keyBindings constant: each Editor owns a copy seeded from
+// defaultKeyBindings, so that edit:bind and edit:unbind only affect the
+// session that calls them.
+type bindingTable map[bufferMode]map[Key]binding
+
+// newBindingTable builds a bindingTable seeded with defaults, the builtin
+// key bindings Elvish ships with.
+func newBindingTable(defaults map[bufferMode]map[Key]string) bindingTable {
+	bt := make(bindingTable, len(defaults))
+	for mode, kb := range defaults {
+		m := make(map[Key]binding, len(kb))
+		for k, name := range kb {
+			m[k] = binding{name: name}
+		}
+		bt[mode] = m
+	}
+	return bt
+}
+
+func (ed *Editor) modeBindings(mode bufferMode) map[Key]binding {
+	if ed.bindings == nil {
+		ed.bindings = newBindingTable(defaultKeyBindings)
+	}
+	if ed.bindings[mode] == nil {
+		ed.bindings[mode] = map[Key]binding{}
+	}
+	return ed.bindings[mode]
+}
+
+// Bind binds key k in mode to the builtin named name.
+func (ed *Editor) Bind(mode bufferMode, k Key, name string) error {
+	if leBuiltins[name] == nil {
+		return fmt.Errorf("no editor builtin named %q", name)
+	}
+	ed.modeBindings(mode)[k] = binding{name: name}
+	return nil
+}
+
+// BindClosure binds key k in mode to closure: when k is pressed, closure
+// is called in the evaluator instead of a builtin being looked up, with
+// access to the editor's state through the edit: namespace.
+func (ed *Editor) BindClosure(mode bufferMode, k Key, closure eval.Value) {
+	ed.modeBindings(mode)[k] = binding{closure: closure}
+}
+
+// Unbind removes any binding for key k in mode that was installed by Bind
+// or BindClosure, reverting it back to whatever defaultKeyBindings
+// specifies (or to the mode's DefaultBinding if it specifies nothing).
+func (ed *Editor) Unbind(mode bufferMode, k Key) {
+	m := ed.modeBindings(mode)
+	delete(m, k)
+	if name, ok := defaultKeyBindings[mode][k]; ok {
+		m[k] = binding{name: name}
+	}
+}
+
+// Binding describes what key k is currently bound to in mode: a builtin
+// name, "<closure>" if it is bound to an Elvish closure, or "" if it is
+// unbound.
+func (ed *Editor) Binding(mode bufferMode, k Key) string {
+	b, ok := ed.modeBindings(mode)[k]
+	if !ok {
+		return ""
+	}
+	if b.closure != nil {
+		return "<closure>"
+	}
+	return b.name
+}
+
+// callClosure invokes an Elvish closure bound via BindClosure in response
+// to keystroke k, giving it access to the current editor state through
+// the edit: namespace (edit:line, edit:dot, edit:mode, edit:insert-at-dot,
+// ...), the same way other user-registered callbacks (e.g. completers)
+// are invoked in the evaluator.
+func (ed *Editor) callClosure(closure eval.Value, k Key) *leReturn {
+	err := ed.ev.Call(closure, eval.NoArgs, ed.namespace())
+	if err != nil {
+		ed.pushTip(err.Error())
+	}
+	return &leReturn{action: noAction}
+}
@@ -0,0 +1,133 @@
+package edit
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// histlist holds the state of modeHistoryListing: a scrollable list of
+// history entries narrowed by an incrementally-typed substring query,
+// similar to readline's reverse-i-search.
+type histlist struct {
+	all     []string
+	query   string
+	matches []int // indices into all, most recent first
+	current int
+}
+
+func newHistlist(all []string) *histlist {
+	hl := &histlist{all: all}
+	hl.refilter()
+	return hl
+}
+
+func (hl *histlist) refilter() {
+	hl.matches = hl.matches[:0]
+	for i := len(hl.all) - 1; i >= 0; i-- {
+		if strings.Contains(hl.all[i], hl.query) {
+			hl.matches = append(hl.matches, i)
+		}
+	}
+	hl.current = 0
+}
+
+func (hl *histlist) setQuery(q string) {
+	hl.query = q
+	hl.refilter()
+}
+
+// selected returns the currently selected match, which is also the one
+// previewed inline in the command buffer.
+func (hl *histlist) selected() (string, bool) {
+	if hl.current < 0 || hl.current >= len(hl.matches) {
+		return "", false
+	}
+	return hl.all[hl.matches[hl.current]], true
+}
+
+func (hl *histlist) prev() {
+	if hl.current < len(hl.matches)-1 {
+		hl.current++
+	}
+}
+
+func (hl *histlist) next() {
+	if hl.current > 0 {
+		hl.current--
+	}
+}
+
+// List renders up to maxHeight matches, most recent first.
+func (hl *histlist) List(maxHeight int) renderer {
+	n := len(hl.matches)
+	if n > maxHeight {
+		n = maxHeight
+	}
+	lines := make([]string, n)
+	for i := 0; i < n; i++ {
+		lines[i] = hl.all[hl.matches[i]]
+	}
+	return linesRenderer{lines, styleForCompletedHistory.String()}
+}
+
+// ModeLine renders the "HISTORY-LISTING query" mode line.
+func (hl *histlist) ModeLine() renderer {
+	return modeLineRenderer{"HISTORY-LISTING", hl.query}
+}
+
+func startHistoryListing(ed *Editor, k Key) *leReturn {
+	items, err := ed.History()
+	if err != nil {
+		ed.pushTip(err.Error())
+		return &leReturn{action: noAction}
+	}
+	ed.histlist = newHistlist(items)
+	return &leReturn{action: changeMode, newMode: modeHistoryListing}
+}
+
+func historyListingDefault(ed *Editor, k Key) *leReturn {
+	if k.Mod != 0 || k.Rune <= 0 {
+		return &leReturn{action: noAction}
+	}
+	ed.histlist.setQuery(ed.histlist.query + string(k.Rune))
+	return &leReturn{action: noAction}
+}
+
+func historyListingBackspace(ed *Editor, k Key) *leReturn {
+	q := ed.histlist.query
+	if len(q) > 0 {
+		_, size := utf8.DecodeLastRuneInString(q)
+		ed.histlist.setQuery(q[:len(q)-size])
+	}
+	return &leReturn{action: noAction}
+}
+
+func historyListingPrev(ed *Editor, k Key) *leReturn {
+	ed.histlist.prev()
+	return &leReturn{action: noAction}
+}
+
+func historyListingNext(ed *Editor, k Key) *leReturn {
+	ed.histlist.next()
+	return &leReturn{action: noAction}
+}
+
+func acceptHistoryListing(ed *Editor, k Key) *leReturn {
+	ed.acceptHistoryListing()
+	return &leReturn{action: changeMode, newMode: modeInsert}
+}
+
+func cancelHistoryListing(ed *Editor, k Key) *leReturn {
+	ed.histlist = nil
+	return &leReturn{action: changeMode, newMode: modeInsert}
+}
+
+func init() {
+	leBuiltins["start-history-listing"] = startHistoryListing
+	leBuiltins["history-listing-default"] = historyListingDefault
+	leBuiltins["history-listing-backspace"] = historyListingBackspace
+	leBuiltins["history-listing-prev"] = historyListingPrev
+	leBuiltins["history-listing-next"] = historyListingNext
+	leBuiltins["accept-history-listing"] = acceptHistoryListing
+	leBuiltins["cancel-history-listing"] = cancelHistoryListing
+}
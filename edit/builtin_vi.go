@@ -0,0 +1,188 @@
+package edit
+
+// viFeed advances the Vi command-mode grammar by one keystroke: it
+// accumulates counts and register prefixes, resolves operators composed
+// with motions or text objects (e.g. "d3w", "ci\""), and applies the
+// doubled-operator shorthand ("dd", "yy", "cc") that acts on the whole
+// line.
+func (ed *Editor) viFeed(k Key) *leReturn {
+	vs := &ed.vi
+	if k.Mod != 0 {
+		vs.reset()
+		return &leReturn{action: noAction}
+	}
+	r := k.Rune
+
+	switch {
+	case vs.pendingReg:
+		vs.pendingReg = false
+		vs.register = r
+		return &leReturn{action: noAction}
+
+	case r == '"' && vs.op == 0:
+		vs.pendingReg = true
+		return &leReturn{action: noAction}
+
+	case (r >= '1' && r <= '9') || (r == '0' && (vs.count > 0 || vs.opCount > 0)):
+		if vs.op == 0 {
+			vs.count = vs.count*10 + int(r-'0')
+		} else {
+			vs.opCount = vs.opCount*10 + int(r-'0')
+		}
+		return &leReturn{action: noAction}
+
+	case vs.pendingTextObj:
+		start, end, ok := textObject(ed.line, ed.dot, vs.textObjKind, r)
+		if !ok {
+			vs.reset()
+			return &leReturn{action: noAction}
+		}
+		ed.applyOperator(start, end)
+		ret := ed.opReturn()
+		vs.reset()
+		return ret
+
+	case vs.op != 0 && (r == 'i' || r == 'a'):
+		vs.pendingTextObj = true
+		vs.textObjKind = r
+		return &leReturn{action: noAction}
+
+	case vs.op != 0 && r == vs.op:
+		// Doubled operator ("dd", "yy", "cc"): act on the whole line.
+		ed.applyOperator(0, len(ed.line))
+		ret := ed.opReturn()
+		vs.reset()
+		return ret
+
+	case vs.op == 0 && (r == 'd' || r == 'y' || r == 'c'):
+		vs.op = r
+		return &leReturn{action: noAction}
+
+	case r == 'p':
+		ed.pasteRegisterCount(vs.register, false, vs.total())
+		vs.reset()
+		return &leReturn{action: noAction}
+
+	case r == 'P':
+		ed.pasteRegisterCount(vs.register, true, vs.total())
+		vs.reset()
+		return &leReturn{action: noAction}
+	}
+
+	fn, ok := motions[r]
+	if !ok {
+		vs.reset()
+		return &leReturn{action: noAction}
+	}
+	newDot, inclusive := fn(ed.line, ed.dot, vs.total())
+	if vs.op == 0 {
+		ed.dot = newDot
+		vs.reset()
+		return &leReturn{action: noAction}
+	}
+	start, end := ed.dot, newDot
+	if start > end {
+		start, end = end, start
+	}
+	if inclusive && end < len(ed.line) {
+		end++
+	}
+	ed.applyOperator(start, end)
+	ret := ed.opReturn()
+	vs.reset()
+	return ret
+}
+
+// applyOperator performs the pending operator on line[start:end),
+// recording the affected text in the register named by the pending
+// register prefix (or the unnamed one).
+func (ed *Editor) applyOperator(start, end int) {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(ed.line) {
+		end = len(ed.line)
+	}
+	text := ed.line[start:end]
+	switch ed.vi.op {
+	case 'y':
+		ed.registers.set(ed.vi.register, text, false)
+		ed.dot = start
+	case 'd', 'c':
+		ed.registers.set(ed.vi.register, text, true)
+		ed.line = ed.line[:start] + ed.line[end:]
+		ed.dot = start
+	}
+}
+
+// opReturn decides the mode transition after the pending operator has run:
+// "c" drops into insert mode at the deletion point, like Vi's "change".
+func (ed *Editor) opReturn() *leReturn {
+	if ed.vi.op == 'c' {
+		return &leReturn{action: changeMode, newMode: modeInsert}
+	}
+	return &leReturn{action: noAction}
+}
+
+// pasteRegister inserts the contents of the register named by name (the
+// unnamed register if name is 0) before or after the dot.
+func (ed *Editor) pasteRegister(name rune, before bool) {
+	text := ed.registers.get(name)
+	if text == "" {
+		return
+	}
+	pos := ed.dot
+	if !before && pos < len(ed.line) {
+		pos++
+	}
+	ed.line = ed.line[:pos] + text + ed.line[pos:]
+	ed.dot = pos + len(text)
+}
+
+// pasteRegisterCount inserts the contents of register name count times,
+// the way Vi's count-prefixed "p"/"P" repeats the paste (e.g. "3p" pastes
+// three concatenated copies). Only the first copy uses pasteRegister's
+// before/after placement rule; every copy after that is appended directly
+// at the new dot, since it must continue right where the previous copy
+// ended rather than skip another character forward.
+func (ed *Editor) pasteRegisterCount(name rune, before bool, count int) {
+	for i := 0; i < count; i++ {
+		ed.pasteRegister(name, before)
+		before = true
+	}
+}
+
+// viFeedBuiltin is the leBuiltin bound to every modeCommand key that takes
+// part in the Vi count/operator/motion/register grammar.
+func viFeedBuiltin(ed *Editor, k Key) *leReturn {
+	return ed.viFeed(k)
+}
+
+// viAppend implements Vi's "a" (append after dot, entering insert mode),
+// unless an operator is already pending, in which case "a" instead starts
+// an "around" text object (as in "da\"").
+func viAppend(ed *Editor, k Key) *leReturn {
+	if ed.vi.op != 0 {
+		return ed.viFeed(k)
+	}
+	if ed.dot < len(ed.line) {
+		ed.dot++
+	}
+	return &leReturn{action: changeMode, newMode: modeInsert}
+}
+
+// pasteRegisterBuiltin implements Vi's "p" (paste after dot) from the
+// register named by a preceding "x prefix, or the unnamed register
+// otherwise. It is bindable on its own, independently of the rest of the
+// Vi grammar.
+func pasteRegisterBuiltin(ed *Editor, k Key) *leReturn {
+	ed.pasteRegister(ed.vi.register, false)
+	ed.vi.reset()
+	return &leReturn{action: noAction}
+}
+
+func init() {
+	leBuiltins["vi-feed"] = viFeedBuiltin
+	leBuiltins["vi-append"] = viAppend
+	leBuiltins["paste-register"] = pasteRegisterBuiltin
+}
@@ -0,0 +1,37 @@
+package edit
+
+import "testing"
+
+func newTestEditor(line string, dot int) *Editor {
+	ed := &Editor{}
+	ed.line = line
+	ed.dot = dot
+	ed.registers = newRegisterStore()
+	return ed
+}
+
+func TestViFeedPaste(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []rune
+		line     string
+		dot      int
+		wantLine string
+	}{
+		{"p", []rune{'p'}, "ac", 0, "abc"},
+		{"P", []rune{'P'}, "ac", 1, "abc"},
+		{"count then p", []rune{'2', 'p'}, "ac", 0, "abbc"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ed := newTestEditor(test.line, test.dot)
+			ed.registers.set('"', "b", false)
+			for _, r := range test.keys {
+				ed.viFeed(Key{Rune: r})
+			}
+			if ed.line != test.wantLine {
+				t.Errorf("line = %q, want %q", ed.line, test.wantLine)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package edit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// completion holds the state of an active Tab-completion: the [start, end)
+// range of the line being replaced and the candidates offered for it.
+type completion struct {
+	start, end int
+	candidates []userCandidate
+	current    int
+}
+
+// selectedCandidate returns the candidate currently highlighted, or the
+// zero value if none is (e.g. there are no candidates).
+func (c *completion) selectedCandidate() userCandidate {
+	if c == nil || c.current < 0 || c.current >= len(c.candidates) {
+		return userCandidate{}
+	}
+	return c.candidates[c.current]
+}
+
+// computeCompletion figures out what to offer for the argument under the
+// cursor: it resolves a user-registered completer for the command head via
+// resolveCompleter, following the same fallback chain resolveCompleter
+// documents (edit:completer replaces the builtin candidates entirely,
+// edit:complete-arg's are merged with them), and falls back to filename
+// completion when nothing user-registered replaces it. It returns nil if
+// there is nothing to offer.
+func computeCompletion(ed *Editor) *completion {
+	start := ed.dot
+	for start > 0 && !unicode.IsSpace(rune(ed.line[start-1])) {
+		start--
+	}
+	end := ed.dot
+	word := ed.line[start:end]
+
+	argv := strings.Fields(ed.line[:start])
+	head := ""
+	if len(argv) > 0 {
+		head = argv[0]
+	}
+	argv = append(argv, word)
+	cursor := len(argv) - 1
+
+	var candidates []userCandidate
+	closure, replacesBuiltin := ed.resolveCompleter(head)
+	if closure != nil {
+		userCands, err := ed.callUserCompleter(closure, argv, cursor)
+		if err != nil {
+			ed.pushTip(err.Error())
+		} else {
+			candidates = append(candidates, userCands...)
+		}
+	}
+	if !replacesBuiltin {
+		candidates = append(candidates, builtinFilenameCandidates(word)...)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return &completion{start: start, end: end, candidates: candidates}
+}
+
+// builtinFilenameCandidates lists filenames in the directory containing
+// word (or the current directory, when word has no slash) whose base name
+// starts with word's base name.
+func builtinFilenameCandidates(word string) []userCandidate {
+	dir, base := filepath.Split(word)
+	lookIn := dir
+	if lookIn == "" {
+		lookIn = "."
+	}
+	entries, err := os.ReadDir(lookIn)
+	if err != nil {
+		return nil
+	}
+	var candidates []userCandidate
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+		text := dir + name
+		if entry.IsDir() {
+			text += "/"
+		}
+		candidates = append(candidates, userCandidate{text: text, display: name})
+	}
+	return candidates
+}
+
+// startCompletion implements Tab in insert mode.
+func startCompletion(ed *Editor, k Key) *leReturn {
+	c := computeCompletion(ed)
+	if c == nil {
+		ed.pushTip("no completion")
+		return &leReturn{action: noAction}
+	}
+	ed.completion = c
+	return &leReturn{action: changeMode, newMode: modeCompletion}
+}
+
+func moveCompletionCurrent(ed *Editor, delta int) {
+	c := ed.completion
+	if c == nil || len(c.candidates) == 0 {
+		return
+	}
+	n := len(c.candidates)
+	c.current = ((c.current+delta)%n + n) % n
+}
+
+func selectCandUp(ed *Editor, k Key) *leReturn {
+	moveCompletionCurrent(ed, -1)
+	return &leReturn{action: noAction}
+}
+
+func selectCandDown(ed *Editor, k Key) *leReturn {
+	moveCompletionCurrent(ed, 1)
+	return &leReturn{action: noAction}
+}
+
+func selectCandLeft(ed *Editor, k Key) *leReturn {
+	moveCompletionCurrent(ed, -1)
+	return &leReturn{action: noAction}
+}
+
+func selectCandRight(ed *Editor, k Key) *leReturn {
+	moveCompletionCurrent(ed, 1)
+	return &leReturn{action: noAction}
+}
+
+func cycleCandRight(ed *Editor, k Key) *leReturn {
+	moveCompletionCurrent(ed, 1)
+	return &leReturn{action: noAction}
+}
+
+func cancelCompletion(ed *Editor, k Key) *leReturn {
+	ed.completion = nil
+	return &leReturn{action: changeMode, newMode: modeInsert}
+}
+
+// defaultCompletion implements every modeCompletion key not otherwise
+// bound: it accepts the current candidate and reprocesses the key in
+// insert mode, the way typing past a completion does in a shell.
+func defaultCompletion(ed *Editor, k Key) *leReturn {
+	ed.acceptCompletion()
+	return &leReturn{action: changeModeAndReprocess, newMode: modeInsert}
+}
+
+func init() {
+	leBuiltins["start-completion"] = startCompletion
+	leBuiltins["cancel-completion"] = cancelCompletion
+	leBuiltins["select-cand-up"] = selectCandUp
+	leBuiltins["select-cand-down"] = selectCandDown
+	leBuiltins["select-cand-left"] = selectCandLeft
+	leBuiltins["select-cand-right"] = selectCandRight
+	leBuiltins["cycle-cand-right"] = cycleCandRight
+	leBuiltins["default-completion"] = defaultCompletion
+}
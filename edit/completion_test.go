@@ -0,0 +1,51 @@
+package edit
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestBuiltinFilenameCandidates(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"foo.txt", "foobar.txt", "bar.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	candidates := builtinFilenameCandidates(filepath.Join(dir, "foo"))
+	var got []string
+	for _, c := range candidates {
+		got = append(got, c.display)
+	}
+	sort.Strings(got)
+
+	want := []string{"foo.txt", "foobar.txt"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("builtinFilenameCandidates = %v, want %v", got, want)
+	}
+}
+
+func TestComputeCompletionFallsBackToFilenames(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "target.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ed := &Editor{}
+	ed.line = "cat " + filepath.Join(dir, "tar")
+	ed.dot = len(ed.line)
+
+	c := computeCompletion(ed)
+	if c == nil {
+		t.Fatal("computeCompletion returned nil, want a completion")
+	}
+	if len(c.candidates) != 1 || c.candidates[0].display != "target.txt" {
+		t.Errorf("candidates = %v, want [target.txt]", c.candidates)
+	}
+	if c.start != len("cat ") {
+		t.Errorf("start = %d, want %d", c.start, len("cat "))
+	}
+}
@@ -0,0 +1,183 @@
+package edit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xiaq/elvish/eval"
+)
+
+// userCandidate is a single completion candidate produced by a
+// user-registered completer: either a plain string, or a
+// [&text= &display= &style=] map, with display defaulting to text and
+// style to no style when omitted.
+type userCandidate struct {
+	text, display, style string
+}
+
+// resolveCompleter looks up a user-registered completer for head (the
+// command head as resolved by goodFormHead), preferring edit:completer
+// -- which replaces the built-in completion for that command entirely --
+// over edit:complete-arg, which only supplies extra candidates to be
+// merged with the built-in filename completion. This is the fallback
+// chain the completion engine consults before falling back to its own
+// filename completion; there is no built-in variable or command
+// completion to merge with.
+func (ed *Editor) resolveCompleter(head string) (closure eval.Value, replacesBuiltin bool) {
+	if c, ok := ed.completers[head]; ok {
+		return c, true
+	}
+	if c, ok := ed.argCompleters[head]; ok {
+		return c, false
+	}
+	return nil, false
+}
+
+// callUserCompleter invokes closure with the parsed argv of the form
+// being completed and the index of the argument the cursor is in, and
+// collects the stream of candidates it produces.
+func (ed *Editor) callUserCompleter(closure eval.Value, argv []string, cursor int) ([]userCandidate, error) {
+	args := make([]eval.Value, len(argv)+1)
+	for i, a := range argv {
+		args[i] = eval.String(a)
+	}
+	args[len(argv)] = eval.String(fmt.Sprint(cursor))
+
+	values, err := ed.ev.CallForValues(closure, args)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]userCandidate, 0, len(values))
+	for _, v := range values {
+		c, ok := toUserCandidate(v)
+		if !ok {
+			return nil, fmt.Errorf("completer produced a value that is neither a string nor a candidate map: %v", v)
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// toUserCandidate converts a value yielded by a user completer -- a plain
+// string, or a map with &text, &display and &style keys -- into a
+// userCandidate.
+func toUserCandidate(v eval.Value) (userCandidate, bool) {
+	switch v := v.(type) {
+	case eval.String:
+		s := string(v)
+		return userCandidate{text: s, display: s}, true
+	case eval.Map:
+		text, ok := stringField(v, "text")
+		if !ok {
+			return userCandidate{}, false
+		}
+		display, ok := stringField(v, "display")
+		if !ok {
+			display = text
+		}
+		style, _ := stringField(v, "style")
+		return userCandidate{text: text, display: display, style: style}, true
+	default:
+		return userCandidate{}, false
+	}
+}
+
+func stringField(m eval.Map, key string) (string, bool) {
+	v, ok := m[key]
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(eval.String)
+	return string(s), ok
+}
+
+// completeGetopt implements edit:complete-getopt, a small getopt-style
+// helper for completer authors: given the argv being completed and a list
+// of option specs of the form "-f,--flag" or "-f,--flag=", it returns
+// which option (if any) is pending an argument at the cursor, and the
+// plain (non-flag) arguments seen so far, so that a completer can dispatch
+// on flags cleanly instead of re-implementing flag parsing itself.
+func completeGetopt(ctx *eval.EvalCtx, rawArgs []eval.Value, opts map[string]eval.Value) (eval.Value, error) {
+	if len(rawArgs) < 2 {
+		return nil, fmt.Errorf("edit:complete-getopt takes at least 2 arguments: argv and optspecs")
+	}
+	argv, ok := toStrings(rawArgs[0])
+	if !ok {
+		return nil, fmt.Errorf("edit:complete-getopt's first argument must be a list of strings")
+	}
+	specs, ok := toStrings(rawArgs[1])
+	if !ok {
+		return nil, fmt.Errorf("edit:complete-getopt's second argument must be a list of strings")
+	}
+
+	takesArg := map[string]bool{}
+	for _, spec := range specs {
+		names := strings.Split(strings.TrimSuffix(spec, "="), ",")
+		for _, name := range names {
+			takesArg[name] = strings.HasSuffix(spec, "=")
+		}
+	}
+
+	var plainArgs []eval.Value
+	pendingFlag := ""
+	for _, arg := range argv {
+		if pendingFlag != "" {
+			pendingFlag = ""
+			continue
+		}
+		if strings.HasPrefix(arg, "-") {
+			if takesArg[arg] {
+				pendingFlag = arg
+			}
+			continue
+		}
+		plainArgs = append(plainArgs, eval.String(arg))
+	}
+
+	return eval.Map{
+		"flag": eval.String(pendingFlag),
+		"args": plainArgs,
+	}, nil
+}
+
+func toStrings(v eval.Value) ([]string, bool) {
+	list, ok := v.([]eval.Value)
+	if !ok {
+		return nil, false
+	}
+	out := make([]string, len(list))
+	for i, item := range list {
+		s, ok := item.(eval.String)
+		if !ok {
+			return nil, false
+		}
+		out[i] = string(s)
+	}
+	return out, true
+}
+
+// registerEditCompletionBuiltins installs edit:complete-arg and
+// edit:completer (mutable registries keyed by command head) and
+// edit:complete-getopt into ed's "edit" namespace. ed.ev's "edit" entry is
+// private to ed (see forkModules in editor.go), so the registries it
+// installs here don't leak to or get clobbered by any other Editor
+// sharing ed.ev.
+func (ed *Editor) registerEditCompletionBuiltins() {
+	if ed.argCompleters == nil {
+		ed.argCompleters = eval.Map{}
+	}
+	if ed.completers == nil {
+		ed.completers = eval.Map{}
+	}
+	ns := ed.ev.Modules["edit"]
+	if ns == nil {
+		ns = map[string]eval.Value{}
+		ed.ev.Modules["edit"] = ns
+	}
+	ns["complete-arg"] = ed.argCompleters
+	ns["completer"] = ed.completers
+	ns[eval.FnPrefix+"complete-getopt"] = &eval.BuiltinFn{
+		Name: "edit:complete-getopt", Impl: completeGetopt,
+	}
+}
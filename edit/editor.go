@@ -6,7 +6,6 @@ import (
 	"os"
 	"strings"
 
-	"github.com/xiaq/elvish/edit/tty"
 	"github.com/xiaq/elvish/eval"
 	"github.com/xiaq/elvish/parse"
 	"github.com/xiaq/elvish/util"
@@ -22,6 +21,7 @@ const (
 	modeCompletion
 	modeNavigation
 	modeHistory
+	modeHistoryListing
 )
 
 type editorState struct {
@@ -35,9 +35,19 @@ type editorState struct {
 	completionLines       int
 	navigation            *navigation
 	history               *historyState
+	histlist              *histlist
+	vi                    viState
+	registers             *registerStore
+	argCompleters         eval.Map
+	completers            eval.Map
 }
 
 type historyState struct {
+	// store is the on-disk, possibly cross-session, history store. It is
+	// nil when the editor has not been configured with a persistent
+	// history file, in which case history only lives for the lifetime of
+	// the process.
+	store         *historyStore
 	items         []string
 	current       int
 	saved, prefix string
@@ -45,15 +55,33 @@ type historyState struct {
 
 // Editor keeps the status of the line editor.
 type Editor struct {
-	savedTermios *tty.Termios
-	file         *os.File
-	writer       *writer
-	reader       *reader
-	ev           *eval.Evaluator
-	sigch        <-chan os.Signal
+	frontend Frontend
+	ev       *eval.Evaluator
+	sigch    <-chan os.Signal
+	bindings bindingTable
 	editorState
 }
 
+// Frontend abstracts away the terminal an Editor's keystrokes come from and
+// its rendered buffer goes to, so that an Editor does not need to own a TTY
+// directly. localFrontend, in frontend.go, is the original in-process
+// implementation talking to a *os.File; the remote-editor protocol in
+// remote.go implements it on top of a socket instead, letting a daemon that
+// owns history and modules serve a lightweight client that just owns the
+// terminal.
+type Frontend interface {
+	// Setup prepares the terminal (or whatever readKey/refresh talk to) for
+	// editing, returning whether the cursor was already at the start of a
+	// line.
+	Setup() (atStartOfLine bool, err error)
+	// Cleanup restores whatever Setup changed.
+	Cleanup() error
+	// ReadKey reads the next keystroke.
+	ReadKey() (Key, error)
+	// Refresh renders the current editor state.
+	Refresh(es *editorState) error
+}
+
 // LineRead is the result of ReadLine. Exactly one member is non-zero, making
 // it effectively a tagged union.
 type LineRead struct {
@@ -64,6 +92,9 @@ type LineRead struct {
 
 func (hs *historyState) append(line string) {
 	hs.items = append(hs.items, line)
+	if hs.store != nil {
+		hs.store.append(line)
+	}
 }
 
 func (hs *historyState) prev() bool {
@@ -86,19 +117,116 @@ func (hs *historyState) next() bool {
 	return false
 }
 
-// New creates an Editor.
+// EnableHistoryStore points ed at a persistent, append-only history file,
+// creating it if necessary. Once enabled, every accepted line is written
+// through to fname, and history is loaded from it instead of only from
+// the current process's memory, so that the history is retained across
+// restarts and shared with other Elvish sessions running concurrently.
+// maxSize caps the number of deduplicated entries kept on disk; a
+// non-positive value falls back to defaultHistorySize.
+func (ed *Editor) EnableHistoryStore(fname string, maxSize int) error {
+	store, err := newHistoryStore(fname, maxSize)
+	if err != nil {
+		return err
+	}
+	items, err := store.all()
+	if err != nil {
+		store.close()
+		return err
+	}
+	ed.history.store = store
+	ed.history.items = items
+	ed.history.current = len(items)
+	return nil
+}
+
+// History returns all entries currently in the history, oldest first. If a
+// persistent store is enabled, it is re-read so that entries added by other
+// concurrent sessions are reflected.
+func (ed *Editor) History() ([]string, error) {
+	if ed.history.store == nil {
+		return append([]string(nil), ed.history.items...), nil
+	}
+	return ed.history.store.all()
+}
+
+// WalkHistory calls f for each history entry, most recent first, stopping
+// early if f returns false.
+func (ed *Editor) WalkHistory(f func(cmd string) bool) error {
+	items, err := ed.History()
+	if err != nil {
+		return err
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		if !f(items[i]) {
+			break
+		}
+	}
+	return nil
+}
+
+// PruneHistory removes every history entry for which keep returns false. If
+// a persistent store is enabled, the file on disk is compacted accordingly.
+func (ed *Editor) PruneHistory(keep func(cmd string) bool) error {
+	items, err := ed.History()
+	if err != nil {
+		return err
+	}
+	kept := items[:0]
+	for _, item := range items {
+		if keep(item) {
+			kept = append(kept, item)
+		}
+	}
+	if ed.history.store == nil {
+		ed.history.items = kept
+		return nil
+	}
+	return ed.history.store.compact(kept)
+}
+
+// New creates an Editor that reads keys from and renders to file.
 func New(file *os.File, tr *util.TimedReader, ev *eval.Evaluator, sigch <-chan os.Signal) *Editor {
-	return &Editor{
-		// savedTermios: term.Copy(),
-		file:   file,
-		writer: newWriter(file),
-		reader: newReader(tr),
-		ev:     ev,
-		sigch:  sigch,
+	return newEditor(&localFrontend{file: file, reader: newReader(tr), writer: newWriter(file)}, ev, sigch)
+}
+
+// newEditor creates an Editor driven by the given Frontend, shared by New
+// (a local terminal) and RunDaemon (a remote client, over a socket). ev is
+// forked with forkModules so that the Editor can freely install its own
+// "edit" module (edit:bind, edit:complete-arg, ...) without clobbering any
+// other Editor sharing the same underlying Evaluator.
+func newEditor(fe Frontend, ev *eval.Evaluator, sigch <-chan os.Signal) *Editor {
+	ed := &Editor{
+		frontend: fe,
+		ev:       forkModules(ev),
+		sigch:    sigch,
+		bindings: newBindingTable(defaultKeyBindings),
 		editorState: editorState{
-			history: &historyState{},
+			history:   &historyState{},
+			registers: newRegisterStore(),
 		},
 	}
+	ed.registerEditBuiltins()
+	ed.registerEditCompletionBuiltins()
+	return ed
+}
+
+// forkModules returns a shallow copy of ev whose top-level Modules map is
+// private to the copy: installing or replacing a module entry (such as
+// "edit") in the copy leaves ev, and any other Editor's copy forked from
+// it, untouched. The namespace of every module neither Editor registers
+// nor replaces is still shared by reference, so globals and modules like
+// "str" or "bool" stay visible and consistent across every Editor sharing
+// ev. This is what lets RunDaemon's serveConn (remote.go) run many
+// concurrent Editor sessions off one *eval.Evaluator without one session's
+// edit:bind or edit:complete-arg registrations clobbering another's.
+func forkModules(ev *eval.Evaluator) *eval.Evaluator {
+	forked := *ev
+	forked.Modules = make(map[string]map[string]eval.Value, len(ev.Modules))
+	for name, ns := range ev.Modules {
+		forked.Modules[name] = ns
+	}
+	return &forked
 }
 
 func (ed *Editor) beep() {
@@ -117,15 +245,38 @@ func (ed *Editor) refresh() error {
 			ed.tokens = append(ed.tokens, token)
 		}
 	}
-	return ed.writer.refresh(&ed.editorState)
+	return ed.frontend.Refresh(&ed.editorState)
 }
 
-// TODO Allow modifiable keybindings.
-var keyBindings = map[bufferMode]map[Key]string{
+// defaultKeyBindings seeds every new Editor's bindingTable; see bindingTable
+// and Editor.Bind for the runtime, per-session structure that replaced the
+// old package-level constant this used to be.
+var defaultKeyBindings = map[bufferMode]map[Key]string{
 	modeCommand: map[Key]string{
 		Key{'i', 0}:    "start-insert",
-		Key{'h', 0}:    "move-dot-left",
-		Key{'l', 0}:    "move-dot-right",
+		Key{'a', 0}:    "vi-append",
+		Key{'h', 0}:    "vi-feed",
+		Key{'l', 0}:    "vi-feed",
+		Key{'w', 0}:    "vi-feed",
+		Key{'b', 0}:    "vi-feed",
+		Key{'e', 0}:    "vi-feed",
+		Key{'0', 0}:    "vi-feed",
+		Key{'$', 0}:    "vi-feed",
+		Key{'d', 0}:    "vi-feed",
+		Key{'y', 0}:    "vi-feed",
+		Key{'c', 0}:    "vi-feed",
+		Key{'p', 0}:    "paste-register",
+		Key{'P', 0}:    "vi-feed",
+		Key{'"', 0}:    "vi-feed",
+		Key{'1', 0}:    "vi-feed",
+		Key{'2', 0}:    "vi-feed",
+		Key{'3', 0}:    "vi-feed",
+		Key{'4', 0}:    "vi-feed",
+		Key{'5', 0}:    "vi-feed",
+		Key{'6', 0}:    "vi-feed",
+		Key{'7', 0}:    "vi-feed",
+		Key{'8', 0}:    "vi-feed",
+		Key{'9', 0}:    "vi-feed",
 		Key{'D', 0}:    "kill-line-right",
 		DefaultBinding: "default-command",
 	},
@@ -144,6 +295,7 @@ var keyBindings = map[bufferMode]map[Key]string{
 		Key{'D', Ctrl}:    "return-eof",
 		Key{Tab, 0}:       "start-completion",
 		Key{PageUp, 0}:    "start-history",
+		Key{'R', Ctrl}:    "start-history-listing",
 		Key{'N', Ctrl}:    "start-navigation",
 		DefaultBinding:    "default-insert",
 	},
@@ -169,13 +321,22 @@ var keyBindings = map[bufferMode]map[Key]string{
 		Key{PageDown, 0}: "select-history-next",
 		DefaultBinding:   "default-history",
 	},
+	modeHistoryListing: map[Key]string{
+		Key{'[', Ctrl}:    "cancel-history-listing",
+		Key{'R', Ctrl}:    "history-listing-prev",
+		Key{Up, 0}:        "history-listing-prev",
+		Key{Down, 0}:      "history-listing-next",
+		Key{Backspace, 0}: "history-listing-backspace",
+		Key{Enter, 0}:     "accept-history-listing",
+		DefaultBinding:    "history-listing-default",
+	},
 }
 
 func init() {
-	for _, kb := range keyBindings {
+	for _, kb := range defaultKeyBindings {
 		for _, name := range kb {
 			if leBuiltins[name] == nil {
-				panic("bad keyBindings table: no editor builtin named " + name)
+				panic("bad defaultKeyBindings table: no editor builtin named " + name)
 			}
 		}
 	}
@@ -199,68 +360,23 @@ func (ed *Editor) acceptHistory() {
 	ed.dot = len(ed.line)
 }
 
-func SetupTerminal(file *os.File) (*tty.Termios, error) {
-	fd := int(file.Fd())
-	term, err := tty.NewTermiosFromFd(fd)
-	if err != nil {
-		return nil, fmt.Errorf("can't get terminal attribute: %s", err)
+// acceptHistoryListing accepts the currently selected match in the history
+// listing mode, if any.
+func (ed *Editor) acceptHistoryListing() {
+	if line, ok := ed.histlist.selected(); ok {
+		ed.line = line
+		ed.dot = len(ed.line)
 	}
-
-	savedTermios := term.Copy()
-
-	term.SetIcanon(false)
-	term.SetEcho(false)
-	term.SetMin(1)
-	term.SetTime(0)
-
-	err = term.ApplyToFd(fd)
-	if err != nil {
-		return nil, fmt.Errorf("can't set up terminal attribute: %s", err)
-	}
-
-	// Set autowrap off
-	file.WriteString("\033[?7l")
-
-	err = tty.FlushInput(fd)
-	if err != nil {
-		return nil, fmt.Errorf("can't flush input: %s", err)
-	}
-
-	return savedTermios, nil
-}
-
-func CleanupTerminal(file *os.File, savedTermios *tty.Termios) error {
-	// Set autowrap on
-	file.WriteString("\033[?7h")
-	fd := int(file.Fd())
-	return savedTermios.ApplyToFd(fd)
+	ed.histlist = nil
 }
 
-// startsReadLine prepares the terminal for the editor.
+// startsReadLine prepares the frontend for the editor.
 func (ed *Editor) startReadLine() error {
-	savedTermios, err := SetupTerminal(ed.file)
-	if err != nil {
-		return err
-	}
-	ed.savedTermios = savedTermios
-
-	// Query cursor location
-	ed.file.WriteString("\033[6n")
-	// BUG(xiaq): In Editor.startReadLine, there is a race condition when user
-	// input sneaked in between WriteString and readCPR
-	x, _, err := ed.reader.readCPR()
-	if err != nil {
-		return err
-	}
-
-	if x != 1 {
-		ed.file.WriteString(LackEOL)
-	}
-
-	return nil
+	_, err := ed.frontend.Setup()
+	return err
 }
 
-// finishReadLine puts the terminal in a state suitable for other programs to
+// finishReadLine puts the frontend in a state suitable for other programs to
 // use.
 func (ed *Editor) finishReadLine(lr *LineRead) {
 	if lr.EOF == false && lr.Err == nil {
@@ -274,15 +390,13 @@ func (ed *Editor) finishReadLine(lr *LineRead) {
 	// TODO Perhaps make it optional to NOT clear the rprompt
 	ed.rprompt = ""
 	ed.refresh() // XXX(xiaq): Ignore possible error
-	ed.file.WriteString("\n")
 
-	err := CleanupTerminal(ed.file, ed.savedTermios)
+	err := ed.frontend.Cleanup()
 
 	if err != nil {
 		// BUG(xiaq): Error in Editor.finishReadLine may override earlier error
 		*lr = LineRead{Err: fmt.Errorf("can't restore terminal attribute: %s", err)}
 	}
-	ed.savedTermios = nil
 }
 
 // ReadLine reads a line interactively.
@@ -299,7 +413,6 @@ func (ed *Editor) ReadLine(prompt, rprompt func() string) (lr LineRead) {
 	ed.tips = nil
 	ed.completion = nil
 	ed.dot = 0
-	ed.writer.oldBuf.cells = nil
 
 	for {
 		ed.prompt = prompt()
@@ -311,24 +424,38 @@ func (ed *Editor) ReadLine(prompt, rprompt func() string) (lr LineRead) {
 
 		ed.tips = nil
 
-		k, err := ed.reader.readKey()
+		k, err := ed.frontend.ReadKey()
 		if err != nil {
 			ed.pushTip(err.Error())
 			continue
 		}
 
 	lookupKey:
-		keyBinding, ok := keyBindings[ed.mode]
-		if !ok {
-			ed.pushTip("No binding for current mode")
-			continue
-		}
+		var ret *leReturn
+		if ed.mode == modeCommand && ed.vi.pending() {
+			// A Vi operator, count or register prefix is awaiting its
+			// next keystroke: feed it directly to the Vi engine instead
+			// of going through ed.bindings, since e.g. a register name
+			// following '"' or an object character following "di" can be
+			// any key, not just ones bound in modeCommand.
+			ret = ed.viFeed(k)
+		} else {
+			keyBinding, ok := ed.bindings[ed.mode]
+			if !ok {
+				ed.pushTip("No binding for current mode")
+				continue
+			}
 
-		name, bound := keyBinding[k]
-		if !bound {
-			name = keyBinding[DefaultBinding]
+			b, bound := keyBinding[k]
+			if !bound {
+				b = keyBinding[DefaultBinding]
+			}
+			if b.closure != nil {
+				ret = ed.callClosure(b.closure, k)
+			} else {
+				ret = leBuiltins[b.name](ed, k)
+			}
 		}
-		ret := leBuiltins[name](ed, k)
 		if ret == nil {
 			continue
 		}
@@ -0,0 +1,98 @@
+package edit
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/xiaq/elvish/edit/tty"
+)
+
+// localFrontend is the original Frontend implementation: it reads keys from
+// and renders directly to a *os.File representing the controlling terminal,
+// the same way the editor worked before the Frontend abstraction was
+// introduced.
+type localFrontend struct {
+	file         *os.File
+	reader       *reader
+	writer       *writer
+	savedTermios *tty.Termios
+}
+
+func (fe *localFrontend) Setup() (bool, error) {
+	savedTermios, err := SetupTerminal(fe.file)
+	if err != nil {
+		return false, err
+	}
+	fe.savedTermios = savedTermios
+	fe.writer.oldBuf.cells = nil
+
+	// Query cursor location
+	fe.file.WriteString("\033[6n")
+	// BUG(xiaq): In localFrontend.Setup, there is a race condition when user
+	// input sneaked in between WriteString and readCPR
+	x, _, err := fe.reader.readCPR()
+	if err != nil {
+		return false, err
+	}
+
+	if x != 1 {
+		fe.file.WriteString(LackEOL)
+	}
+	return x == 1, nil
+}
+
+func (fe *localFrontend) Cleanup() error {
+	fe.file.WriteString("\n")
+	err := CleanupTerminal(fe.file, fe.savedTermios)
+	fe.savedTermios = nil
+	return err
+}
+
+func (fe *localFrontend) ReadKey() (Key, error) {
+	return fe.reader.readKey()
+}
+
+func (fe *localFrontend) Refresh(es *editorState) error {
+	return fe.writer.refresh(es)
+}
+
+// SetupTerminal puts the terminal file is attached to into the raw,
+// non-echoing mode the editor needs, returning the previous attributes so
+// they can be restored by CleanupTerminal.
+func SetupTerminal(file *os.File) (*tty.Termios, error) {
+	fd := int(file.Fd())
+	term, err := tty.NewTermiosFromFd(fd)
+	if err != nil {
+		return nil, fmt.Errorf("can't get terminal attribute: %s", err)
+	}
+
+	savedTermios := term.Copy()
+
+	term.SetIcanon(false)
+	term.SetEcho(false)
+	term.SetMin(1)
+	term.SetTime(0)
+
+	err = term.ApplyToFd(fd)
+	if err != nil {
+		return nil, fmt.Errorf("can't set up terminal attribute: %s", err)
+	}
+
+	// Set autowrap off
+	file.WriteString("\033[?7l")
+
+	err = tty.FlushInput(fd)
+	if err != nil {
+		return nil, fmt.Errorf("can't flush input: %s", err)
+	}
+
+	return savedTermios, nil
+}
+
+// CleanupTerminal restores the terminal attributes saved by SetupTerminal.
+func CleanupTerminal(file *os.File, savedTermios *tty.Termios) error {
+	// Set autowrap on
+	file.WriteString("\033[?7h")
+	fd := int(file.Fd())
+	return savedTermios.ApplyToFd(fd)
+}
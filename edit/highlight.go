@@ -11,30 +11,44 @@ import (
 
 type Highlighter struct {
 	goodFormHead func(string) bool
+	goodVariable func(string) bool
 	addStyling   func(begin, end int, style string)
+	addTip       func(string)
 }
 
 func highlight(n parse.Node, ed *Editor) {
 	s := &Highlighter{
 		func(s string) bool { return goodFormHead(s, ed) },
+		func(s string) bool { return goodVariable(s, ed) },
 		ed.styling.add,
+		ed.pushTip,
 	}
-	s.highlight(n)
+	s.highlight(n, nil)
 }
 
-func (s *Highlighter) highlight(n parse.Node) {
+// isLambdaParamBar reports whether parent is the Primary of a lambda, i.e.
+// whether a "|" Sep that is a direct child of parent is one of the pair of
+// parameter-list delimiters in "{ |x y| ... }", as opposed to an ordinary
+// pipeline's pipe: a pipeline's Seps are children of its Pipeline node, not
+// of a Lambda Primary, so this is enough to tell the two apart.
+func isLambdaParamBar(parent parse.Node) bool {
+	p, ok := parent.(*parse.Primary)
+	return ok && p.Type == parse.Lambda
+}
+
+func (s *Highlighter) highlight(n parse.Node, parent parse.Node) {
 	switch n := n.(type) {
 	case *parse.Form:
 		for _, an := range n.Assignments {
 			if an.Left != nil && an.Left.Head != nil {
 				v := an.Left.Head
-				s.addStyling(v.Begin(), v.End(), styleForGoodVariable.String())
+				s.addStyling(v.Begin(), v.End(), styleForVariableDef.String())
 			}
 		}
 		for _, cn := range n.Vars {
 			if len(cn.Indexings) > 0 && cn.Indexings[0].Head != nil {
 				v := cn.Indexings[0].Head
-				s.addStyling(v.Begin(), v.End(), styleForGoodVariable.String())
+				s.addStyling(v.Begin(), v.End(), styleForVariableDef.String())
 			}
 		}
 		if n.Head != nil {
@@ -46,7 +60,7 @@ func (s *Highlighter) highlight(n parse.Node) {
 			case "for":
 				if len(n.Args) >= 1 && len(n.Args[0].Indexings) > 0 {
 					v := n.Args[0].Indexings[0].Head
-					s.addStyling(v.Begin(), v.End(), styleForGoodVariable.String())
+					s.addStyling(v.Begin(), v.End(), styleForVariableDef.String())
 				}
 				if len(n.Args) >= 4 && n.Args[3].SourceText() == "else" {
 					a := n.Args[3]
@@ -67,7 +81,7 @@ func (s *Highlighter) highlight(n parse.Node) {
 				if highlightKeyword("except") {
 					if i+1 < len(n.Args) && len(n.Args[i+1].Indexings) > 0 {
 						v := n.Args[i+1].Indexings[0]
-						s.addStyling(v.Begin(), v.End(), styleForGoodVariable.String())
+						s.addStyling(v.Begin(), v.End(), styleForVariableDef.String())
 					}
 					i += 3
 				}
@@ -75,20 +89,61 @@ func (s *Highlighter) highlight(n parse.Node) {
 					i += 2
 				}
 				highlightKeyword("finally")
+			case "if":
+				for _, a := range n.Args {
+					if t := a.SourceText(); t == "elif" || t == "else" {
+						s.addStyling(a.Begin(), a.End(), styleForSep[t])
+					}
+				}
+			case "while":
+				for _, a := range n.Args {
+					if a.SourceText() == "else" {
+						s.addStyling(a.Begin(), a.End(), styleForSep["else"])
+					}
+				}
+			case "fn":
+				// The compound right after "fn" is the name being
+				// defined, like a variable assignment's LHS.
+				if len(n.Args) >= 1 && len(n.Args[0].Indexings) > 0 {
+					v := n.Args[0].Indexings[0].Head
+					s.addStyling(v.Begin(), v.End(), styleForVariableDef.String())
+				}
 			}
 		}
 	case *parse.Primary:
-		s.addStyling(n.Begin(), n.End(), styleForPrimary[n.Type].String())
+		if n.Type == parse.Variable {
+			s.variable(n)
+		} else {
+			s.addStyling(n.Begin(), n.End(), styleForPrimary[n.Type].String())
+		}
 	case *parse.Sep:
 		septext := n.SourceText()
 		if strings.HasPrefix(septext, "#") {
 			s.addStyling(n.Begin(), n.End(), styleForComment.String())
+		} else if septext == "|" && isLambdaParamBar(parent) {
+			// The parameter-list delimiter of a closure, e.g. "{ |x y| ... }",
+			// as opposed to an ordinary pipeline's "|".
+			s.addStyling(n.Begin(), n.End(), styleForClosureBar.String())
 		} else {
 			s.addStyling(n.Begin(), n.End(), styleForSep[septext])
 		}
 	}
 	for _, child := range n.Children() {
-		s.highlight(child)
+		s.highlight(child, n)
+	}
+}
+
+// variable styles a "$foo"-style variable use, distinguishing a reference
+// to a variable that resolves somewhere (the global scope, a builtin, or
+// an imported module, mirroring goodFormHead's lookup) from one that
+// doesn't, in which case it also leaves a tip explaining so.
+func (s *Highlighter) variable(n *parse.Primary) {
+	name := strings.TrimPrefix(n.SourceText(), "$")
+	if s.goodVariable(name) {
+		s.addStyling(n.Begin(), n.End(), styleForGoodVariable.String())
+	} else {
+		s.addStyling(n.Begin(), n.End(), styleForBadVariable.String())
+		s.addTip("unknown variable $" + name)
 	}
 }
 
@@ -137,6 +192,21 @@ func goodFormHead(head string, ed *Editor) bool {
 	}
 }
 
+// goodVariable reports whether name (without its leading "$") resolves to
+// a variable somewhere visible from the editor: the evaler's global
+// scope, the builtin namespace, or an imported module, the same places
+// goodFormHead consults for command heads.
+func goodVariable(name string, ed *Editor) bool {
+	explode, ns, name := eval.ParseVariable(name)
+	_ = explode
+	switch ns {
+	case "":
+		return eval.Builtin()[name] != nil || ed.evaler.Global[name] != nil
+	default:
+		return ed.evaler.Modules[ns] != nil && ed.evaler.Modules[ns][name] != nil
+	}
+}
+
 var isBuiltinSpecial = map[string]bool{}
 
 func init() {
@@ -145,6 +215,16 @@ func init() {
 	}
 }
 
+// styleForClosureBar, styleForVariableDef and styleForBadVariable give the
+// closure parameter-list delimiter, newly-defined variables (loop/except/fn
+// targets, assignment LHSes) and unresolved variable uses their own styles,
+// distinct from styleForGoodCommand, styleForGoodVariable and each other.
+var (
+	styleForClosureBar  = styles{"yellow"}
+	styleForVariableDef = styles{"cyan"}
+	styleForBadVariable = styles{"red", "underlined"}
+)
+
 func isDir(fname string) bool {
 	stat, err := os.Stat(fname)
 	return err == nil && stat.IsDir()
@@ -0,0 +1,188 @@
+package edit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultHistorySize is the number of most recent, deduplicated commands
+// kept in the on-disk history file before it is compacted.
+const defaultHistorySize = 10000
+
+// compactEvery controls how often append checks whether the store has
+// grown past its size limit, so that a session does not rewrite the whole
+// history file after every single command.
+const compactEvery = 32
+
+// historyStore is a persistent, append-only history file that can be
+// shared by multiple concurrent Elvish sessions: every session appends new
+// commands to the end of the file and re-reads it to pick up entries
+// written by others. The file is periodically compacted (deduplicated and
+// truncated to maxSize entries) so that it does not grow without bound.
+type historyStore struct {
+	mutex   sync.Mutex
+	fname   string
+	file    *os.File
+	maxSize int
+	seq     int
+}
+
+// newHistoryStore opens, creating if necessary, the history file at fname.
+func newHistoryStore(fname string, maxSize int) (*historyStore, error) {
+	if maxSize <= 0 {
+		maxSize = defaultHistorySize
+	}
+	err := os.MkdirAll(filepath.Dir(fname), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("can't create history directory: %s", err)
+	}
+	file, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("can't open history file: %s", err)
+	}
+	return &historyStore{fname: fname, file: file, maxSize: maxSize}, nil
+}
+
+// encodeEntry escapes backslashes and newlines so that each history entry
+// occupies exactly one line on disk. Backslashes must be escaped first, or
+// a command already containing a literal "\n" (e.g. from a single-quoted
+// regexp) would be indistinguishable from an escaped newline on decode.
+func encodeEntry(cmd string) string {
+	cmd = strings.Replace(cmd, "\\", "\\\\", -1)
+	return strings.Replace(cmd, "\n", "\\n", -1)
+}
+
+func decodeEntry(line string) string {
+	var buf strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' && i+1 < len(line) {
+			switch line[i+1] {
+			case 'n':
+				buf.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				buf.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		buf.WriteByte(line[i])
+	}
+	return buf.String()
+}
+
+// all returns every entry currently on disk, oldest first.
+func (hs *historyStore) all() ([]string, error) {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+	return hs.readAll()
+}
+
+func (hs *historyStore) readAll() ([]string, error) {
+	_, err := hs.file.Seek(0, os.SEEK_SET)
+	if err != nil {
+		return nil, err
+	}
+	var items []string
+	scanner := bufio.NewScanner(hs.file)
+	for scanner.Scan() {
+		items = append(items, decodeEntry(scanner.Text()))
+	}
+	return items, scanner.Err()
+}
+
+// append records cmd, skipping it if it is identical to the most recent
+// entry, and compacts the file once it has grown past maxSize.
+func (hs *historyStore) append(cmd string) error {
+	if cmd == "" {
+		return nil
+	}
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+
+	items, err := hs.readAll()
+	if err != nil {
+		return err
+	}
+	if len(items) > 0 && items[len(items)-1] == cmd {
+		return nil
+	}
+	_, err = hs.file.Seek(0, os.SEEK_END)
+	if err != nil {
+		return err
+	}
+	_, err = hs.file.WriteString(encodeEntry(cmd) + "\n")
+	if err != nil {
+		return err
+	}
+	hs.seq++
+	if len(items)+1 > hs.maxSize && hs.seq%compactEvery == 0 {
+		return hs.compactLocked(append(items, cmd))
+	}
+	return nil
+}
+
+// compact deduplicates entries (keeping the most recent occurrence of
+// each) and trims them down to maxSize, rewriting the on-disk file.
+func (hs *historyStore) compact(items []string) error {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+	return hs.compactLocked(items)
+}
+
+func (hs *historyStore) compactLocked(items []string) error {
+	seen := make(map[string]bool, len(items))
+	deduped := make([]string, 0, len(items))
+	for i := len(items) - 1; i >= 0; i-- {
+		if seen[items[i]] {
+			continue
+		}
+		seen[items[i]] = true
+		deduped = append(deduped, items[i])
+	}
+	// deduped is newest-first; reverse it back to oldest-first.
+	for i, j := 0, len(deduped)-1; i < j; i, j = i+1, j-1 {
+		deduped[i], deduped[j] = deduped[j], deduped[i]
+	}
+	if len(deduped) > hs.maxSize {
+		deduped = deduped[len(deduped)-hs.maxSize:]
+	}
+
+	tmpName := hs.fname + ".tmp" + strconv.Itoa(os.Getpid())
+	tmp, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	for _, item := range deduped {
+		if _, err := tmp.WriteString(encodeEntry(item) + "\n"); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, hs.fname); err != nil {
+		return err
+	}
+	hs.file.Close()
+	file, err := os.OpenFile(hs.fname, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	hs.file = file
+	return nil
+}
+
+// close releases the underlying file descriptor.
+func (hs *historyStore) close() error {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+	return hs.file.Close()
+}
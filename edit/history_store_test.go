@@ -0,0 +1,105 @@
+package edit
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestHistoryStore(t *testing.T, maxSize int) *historyStore {
+	hs, err := newHistoryStore(filepath.Join(t.TempDir(), "history"), maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hs.close() })
+	return hs
+}
+
+func TestHistoryStoreAppendAndAll(t *testing.T) {
+	hs := newTestHistoryStore(t, 0)
+	for _, cmd := range []string{"echo a", "echo b", "echo c"} {
+		if err := hs.append(cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := hs.all()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"echo a", "echo b", "echo c"}
+	if !equalStrings(items, want) {
+		t.Errorf("all() = %v, want %v", items, want)
+	}
+}
+
+func TestHistoryStoreAppendDedupsConsecutive(t *testing.T) {
+	hs := newTestHistoryStore(t, 0)
+	hs.append("echo a")
+	hs.append("echo a")
+	hs.append("echo b")
+	items, _ := hs.all()
+	want := []string{"echo a", "echo b"}
+	if !equalStrings(items, want) {
+		t.Errorf("all() = %v, want %v", items, want)
+	}
+}
+
+func TestHistoryStoreAppendSkipsEmpty(t *testing.T) {
+	hs := newTestHistoryStore(t, 0)
+	hs.append("")
+	items, _ := hs.all()
+	if len(items) != 0 {
+		t.Errorf("all() = %v, want empty", items)
+	}
+}
+
+func TestHistoryStoreCompactDedupsKeepingMostRecent(t *testing.T) {
+	hs := newTestHistoryStore(t, 0)
+	items := []string{"a", "b", "a", "c"}
+	if err := hs.compact(items); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := hs.all()
+	want := []string{"b", "a", "c"}
+	if !equalStrings(got, want) {
+		t.Errorf("all() = %v, want %v", got, want)
+	}
+}
+
+func TestHistoryStoreCompactTrimsToMaxSize(t *testing.T) {
+	hs := newTestHistoryStore(t, 2)
+	if err := hs.compact([]string{"a", "b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := hs.all()
+	want := []string{"b", "c"}
+	if !equalStrings(got, want) {
+		t.Errorf("all() = %v, want %v", got, want)
+	}
+}
+
+func TestHistoryStoreEncodeDecodeEntry(t *testing.T) {
+	cmds := []string{
+		"echo \"a\nb\"",
+		`grep '\n' file`,
+		`echo '\\n'`,
+		`echo a\b`,
+	}
+	for _, cmd := range cmds {
+		encoded := encodeEntry(cmd)
+		if decodeEntry(encoded) != cmd {
+			t.Errorf("decodeEntry(encodeEntry(%q)) = %q, want %q", cmd, decodeEntry(encoded), cmd)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package edit
+
+// registerStore implements Vi-style yank/kill/paste registers: the
+// unnamed register ("\""), 10 numbered registers ("0-"9, auto-populated by
+// yanks and deletes), and 26 lettered registers ("a-"z), where using the
+// uppercase name of a lettered register appends to its existing contents
+// instead of replacing them.
+type registerStore struct {
+	unnamed  string
+	numbered [10]string
+	lettered [26]string
+}
+
+func newRegisterStore() *registerStore {
+	return &registerStore{}
+}
+
+// set stores text under the register named by name, following Vi's naming
+// convention: 0 or '"' for the unnamed register, '0'-'9' for a numbered
+// register, and 'a'-'z'/'A'-'Z' for a lettered one. isDelete distinguishes
+// a kill/change (which also shifts the numbered registers, like Vi's
+// unnamed delete) from a yank (which only populates "0). Every successful
+// set also updates the unnamed register, mirroring Vi.
+func (rs *registerStore) set(name rune, text string, isDelete bool) {
+	switch {
+	case name == 0 || name == '"':
+		if isDelete {
+			rs.shiftNumbered(text)
+		} else {
+			rs.numbered[0] = text
+		}
+	case name >= '0' && name <= '9':
+		rs.numbered[name-'0'] = text
+	case name >= 'a' && name <= 'z':
+		rs.lettered[name-'a'] = text
+	case name >= 'A' && name <= 'Z':
+		rs.lettered[name-'A'] += text
+	default:
+		return
+	}
+	rs.unnamed = text
+}
+
+// shiftNumbered implements Vi's behaviour where an unnamed delete or
+// change pushes "1 through "9 down by one slot and stores the new text in
+// "1, leaving "0 reserved for yanks.
+func (rs *registerStore) shiftNumbered(text string) {
+	for i := 9; i > 1; i-- {
+		rs.numbered[i] = rs.numbered[i-1]
+	}
+	rs.numbered[1] = text
+}
+
+// get retrieves the text stored under the register named by name. A name
+// of 0 means the unnamed register.
+func (rs *registerStore) get(name rune) string {
+	switch {
+	case name == 0 || name == '"':
+		return rs.unnamed
+	case name >= '0' && name <= '9':
+		return rs.numbered[name-'0']
+	case name >= 'a' && name <= 'z':
+		return rs.lettered[name-'a']
+	case name >= 'A' && name <= 'Z':
+		return rs.lettered[name-'A']
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package edit
+
+import "testing"
+
+func TestRegisterStoreUnnamed(t *testing.T) {
+	rs := newRegisterStore()
+	rs.set('"', "foo", false)
+	if got := rs.get('"'); got != "foo" {
+		t.Errorf("get('\"') = %q, want %q", got, "foo")
+	}
+	if got := rs.get(0); got != "foo" {
+		t.Errorf("get(0) = %q, want %q", got, "foo")
+	}
+}
+
+func TestRegisterStoreYankPopulatesZeroOnly(t *testing.T) {
+	rs := newRegisterStore()
+	rs.set('"', "yanked", false)
+	if got := rs.numbered[0]; got != "yanked" {
+		t.Errorf("numbered[0] = %q, want %q", got, "yanked")
+	}
+	if got := rs.numbered[1]; got != "" {
+		t.Errorf("numbered[1] = %q, want empty", got)
+	}
+}
+
+func TestRegisterStoreDeleteShiftsNumbered(t *testing.T) {
+	rs := newRegisterStore()
+	rs.set('"', "first", true)
+	rs.set('"', "second", true)
+	if got := rs.numbered[1]; got != "second" {
+		t.Errorf("numbered[1] = %q, want %q", got, "second")
+	}
+	if got := rs.numbered[2]; got != "first" {
+		t.Errorf("numbered[2] = %q, want %q", got, "first")
+	}
+	// A delete never touches "0, which only yanks populate.
+	if got := rs.numbered[0]; got != "" {
+		t.Errorf("numbered[0] = %q, want empty", got)
+	}
+}
+
+func TestRegisterStoreLettered(t *testing.T) {
+	rs := newRegisterStore()
+	rs.set('a', "one", false)
+	rs.set('A', "two", false)
+	if got := rs.get('a'); got != "onetwo" {
+		t.Errorf("get('a') = %q, want %q", got, "onetwo")
+	}
+}
@@ -0,0 +1,343 @@
+package edit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/xiaq/elvish/edit/tty"
+	"github.com/xiaq/elvish/eval"
+	"github.com/xiaq/elvish/util"
+)
+
+// This file implements the remote-editor protocol: a long-lived daemon
+// owns the Evaluator, history store and modules, and serves any number of
+// concurrent Editor sessions, each driven by a lightweight client that
+// owns nothing but a terminal. A client connects over a Unix socket with
+// RunClient; a daemon listens with RunDaemon. This lets e.g. "elvish
+// -daemon" keep history and completion warm across many short-lived
+// "elvish -connect" client invocations, all sharing one history store.
+//
+// The wire format is a sequence of frames, each a 4-byte big-endian length
+// prefix followed by that many bytes of JSON: {"kind": ..., "body": ...}.
+// It is not meant to be efficient, only simple enough for both ends of
+// this package to agree on.
+
+type frameKind string
+
+const (
+	frameSetup    frameKind = "setup"    // daemon -> client: please prepare the terminal
+	frameSetupAck frameKind = "setupAck" // client -> daemon: terminal ready
+	frameKey      frameKind = "key"      // client -> daemon: a keystroke
+	frameRefresh  frameKind = "refresh"  // daemon -> client: re-render the buffer
+	frameCleanup  frameKind = "cleanup"  // daemon -> client: please restore the terminal
+	frameDone     frameKind = "done"     // daemon -> client: ReadLine returned
+)
+
+type frame struct {
+	Kind frameKind       `json:"kind"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// writeFrame encodes kind and body as a frame and writes it to w, prefixed
+// by its length.
+func writeFrame(w *bufio.Writer, kind frameKind, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	f, err := json.Marshal(frame{Kind: kind, Body: b})
+	if err != nil {
+		return err
+	}
+	var lenbuf [4]byte
+	binary.BigEndian.PutUint32(lenbuf[:], uint32(len(f)))
+	if _, err := w.Write(lenbuf[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(f); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// readFrame reads one frame from r.
+func readFrame(r *bufio.Reader) (frame, error) {
+	var lenbuf [4]byte
+	if _, err := io.ReadFull(r, lenbuf[:]); err != nil {
+		return frame{}, err
+	}
+	n := binary.BigEndian.Uint32(lenbuf[:])
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return frame{}, err
+	}
+	var f frame
+	if err := json.Unmarshal(body, &f); err != nil {
+		return frame{}, err
+	}
+	return f, nil
+}
+
+// renderedBuffer is what the daemon sends the client on every refresh: the
+// prompt, buffer text and cursor position to display. Unlike the local
+// writer, this is not diffed against the previous frame; the client just
+// redraws, since the wire is assumed to be a local socket and frames are
+// small.
+type renderedBuffer struct {
+	Prompt, RPrompt, Line string
+	Dot                   int
+	Tips                  []string
+}
+
+func renderForWire(es *editorState) renderedBuffer {
+	return renderedBuffer{
+		Prompt:  es.prompt,
+		RPrompt: es.rprompt,
+		Line:    es.line,
+		Dot:     es.dot,
+		Tips:    es.tips,
+	}
+}
+
+// remoteFrontend is the daemon-side Frontend: it has no terminal of its
+// own, and instead ferries keystrokes and rendered buffers to and from a
+// client over conn.
+type remoteFrontend struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func newRemoteFrontend(conn net.Conn) *remoteFrontend {
+	return &remoteFrontend{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+}
+
+func (fe *remoteFrontend) Setup() (bool, error) {
+	if err := writeFrame(fe.w, frameSetup, nil); err != nil {
+		return false, err
+	}
+	f, err := readFrame(fe.r)
+	if err != nil {
+		return false, err
+	}
+	if f.Kind != frameSetupAck {
+		return false, fmt.Errorf("remote: expected setupAck frame, got %s", f.Kind)
+	}
+	var atStartOfLine bool
+	if err := json.Unmarshal(f.Body, &atStartOfLine); err != nil {
+		return false, err
+	}
+	return atStartOfLine, nil
+}
+
+func (fe *remoteFrontend) Cleanup() error {
+	return writeFrame(fe.w, frameCleanup, nil)
+}
+
+func (fe *remoteFrontend) ReadKey() (Key, error) {
+	f, err := readFrame(fe.r)
+	if err != nil {
+		return Key{}, err
+	}
+	if f.Kind != frameKey {
+		return Key{}, fmt.Errorf("remote: expected key frame, got %s", f.Kind)
+	}
+	var k Key
+	if err := json.Unmarshal(f.Body, &k); err != nil {
+		return Key{}, err
+	}
+	return k, nil
+}
+
+func (fe *remoteFrontend) Refresh(es *editorState) error {
+	return writeFrame(fe.w, frameRefresh, renderForWire(es))
+}
+
+// RunDaemon listens on sockPath and serves one Editor per connection, all
+// sharing histFname as a common history store. It only returns if
+// listening on sockPath or Accept fails.
+func RunDaemon(sockPath, histFname string, ev *eval.Evaluator, prompt, rprompt func() string) error {
+	os.Remove(sockPath)
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		return fmt.Errorf("can't listen on %s: %s", sockPath, err)
+	}
+	defer ln.Close()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(conn, histFname, ev, prompt, rprompt)
+	}
+}
+
+// serveConn drives a single remote Editor session for the lifetime of
+// conn, reading lines until the client disconnects or sends EOF.
+func serveConn(conn net.Conn, histFname string, ev *eval.Evaluator, prompt, rprompt func() string) {
+	defer conn.Close()
+
+	fe := newRemoteFrontend(conn)
+	ed := newEditor(fe, ev, nil)
+	if histFname != "" {
+		if err := ed.EnableHistoryStore(histFname, 0); err != nil {
+			writeFrame(fe.w, frameDone, LineRead{Err: err})
+			return
+		}
+	}
+
+	for {
+		lr := ed.ReadLine(prompt, rprompt)
+		if err := writeFrame(fe.w, frameDone, lr); err != nil {
+			return
+		}
+		if lr.EOF || lr.Err != nil {
+			return
+		}
+	}
+}
+
+// clientWriter serializes frame writes to w: forwardKeys's persistent
+// goroutine and RunClient's own frame writes (e.g. frameSetupAck) both
+// write to the same connection, and *bufio.Writer is not safe for
+// concurrent use.
+type clientWriter struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func (cw *clientWriter) writeFrame(kind frameKind, body interface{}) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return writeFrame(cw.w, kind, body)
+}
+
+// RunClient connects to a daemon listening on sockPath, and services its
+// requests to set up and clean up file (the client's own terminal), send
+// it keystrokes and render its buffer, for as many ReadLine rounds as the
+// daemon cares to run over this one connection: every time it reports
+// that ReadLine has returned, onLine is called with the result, and the
+// loop continues to the next round -- matching serveConn's own loop over
+// the connection -- unless onLine returns false. RunClient itself only
+// returns once the connection ends, either because onLine said to stop
+// or because of a connection error.
+func RunClient(file *os.File, tr *util.TimedReader, sockPath string, onLine func(LineRead) bool) error {
+	conn, err := net.Dial("unix", sockPath)
+	if err != nil {
+		return fmt.Errorf("can't connect to %s: %s", sockPath, err)
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := &clientWriter{w: bufio.NewWriter(conn)}
+	reader := newReader(tr)
+
+	// forwardKeys runs for the lifetime of the connection, not just one
+	// ReadLine round: starting it afresh on every frameSetup would leave
+	// the previous round's goroutine still reading keys forever (it only
+	// stops on a read error), so two goroutines would race on reader and
+	// on w. It is started once, right after the first round's cursor
+	// position query below, so that it cannot steal that query's reply.
+
+	var savedTermios *tty.Termios
+	first := true
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			return err
+		}
+		switch f.Kind {
+		case frameSetup:
+			st, err := SetupTerminal(file)
+			if err != nil {
+				return err
+			}
+			savedTermios = st
+
+			// Query cursor location, the same way localFrontend.Setup
+			// does. This only works on the first round: from the second
+			// round on, forwardKeys is already draining the connection's
+			// input for keystrokes and would steal the CPR reply: but by
+			// then the previous round's frameCleanup has just written a
+			// newline, so the cursor is already known to be at the start
+			// of the line.
+			atStartOfLine := true
+			if first {
+				first = false
+				file.WriteString("\033[6n")
+				x, _, err := reader.readCPR()
+				if err != nil {
+					return err
+				}
+				if x != 1 {
+					file.WriteString(LackEOL)
+				}
+				atStartOfLine = x == 1
+				go forwardKeys(reader, w)
+			}
+			if err := w.writeFrame(frameSetupAck, atStartOfLine); err != nil {
+				return err
+			}
+		case frameRefresh:
+			var rb renderedBuffer
+			if err := json.Unmarshal(f.Body, &rb); err != nil {
+				return err
+			}
+			writeRenderedBuffer(file, rb)
+		case frameCleanup:
+			file.WriteString("\n")
+			if savedTermios != nil {
+				if err := CleanupTerminal(file, savedTermios); err != nil {
+					return err
+				}
+				savedTermios = nil
+			}
+		case frameDone:
+			var lr LineRead
+			if err := json.Unmarshal(f.Body, &lr); err != nil {
+				return err
+			}
+			if !onLine(lr) {
+				return nil
+			}
+		default:
+			return fmt.Errorf("remote: unexpected frame %s", f.Kind)
+		}
+	}
+}
+
+// forwardKeys reads keystrokes from reader and relays each one to the
+// daemon as a key frame, until reading fails (typically because the
+// connection, and therefore the session, has ended).
+func forwardKeys(reader *reader, w *clientWriter) {
+	for {
+		k, err := reader.readKey()
+		if err != nil {
+			return
+		}
+		if err := w.writeFrame(frameKey, k); err != nil {
+			return
+		}
+	}
+}
+
+// writeRenderedBuffer draws a renderedBuffer sent by the daemon. Unlike
+// the local writer, it does not diff against the previous frame.
+func writeRenderedBuffer(file *os.File, rb renderedBuffer) {
+	file.WriteString("\r\033[J")
+	file.WriteString(rb.Prompt)
+	file.WriteString(rb.Line)
+	if rb.RPrompt != "" {
+		file.WriteString(" " + rb.RPrompt)
+	}
+	for _, tip := range rb.Tips {
+		file.WriteString("\n" + tip)
+	}
+}
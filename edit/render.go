@@ -246,6 +246,11 @@ func (er *editorRenderer) render(buf *buffer) {
 	case modeHistory:
 		begin := len(es.hist.prefix)
 		clr.setHist(begin, es.hist.line[begin:])
+	case modeHistoryListing:
+		if line, ok := es.histlist.selected(); ok && strings.HasPrefix(line, es.line) {
+			begin := len(es.line)
+			clr.setHist(begin, line[begin:])
+		}
 	}
 	bufLine = render(clr, width)
 
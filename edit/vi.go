@@ -0,0 +1,214 @@
+package edit
+
+import "unicode"
+
+// viState carries the pending count, operator and register-name state of
+// Vi command mode across keystrokes, so that multi-key commands such as
+// "d3w", "\"ayy" or "ci\"" can be typed one key at a time while still
+// being dispatched as a single operator-motion (or register) command.
+type viState struct {
+	count          int  // count typed before the operator or motion, 0 if none
+	op             rune // pending operator: 'd', 'y', 'c', or 0 if none
+	opCount        int  // count typed between the operator and its motion
+	register       rune // register named by a preceding "x, 0 for unnamed
+	pendingReg     bool // true right after '"', awaiting the register name
+	pendingTextObj bool // true right after an operator + 'i'/'a'
+	textObjKind    rune // 'i' or 'a', valid when pendingTextObj is true
+}
+
+// pending reports whether ed is in the middle of a multi-key Vi command,
+// in which case the next keystroke must bypass the normal ed.bindings
+// lookup and be fed to it directly.
+func (vs *viState) pending() bool {
+	return vs.op != 0 || vs.count != 0 || vs.opCount != 0 ||
+		vs.pendingReg || vs.pendingTextObj
+}
+
+func (vs *viState) reset() { *vs = viState{} }
+
+// total combines the count given before the operator with the one given
+// before the motion, the way Vi does (e.g. "2d3w" deletes 6 words),
+// defaulting to 1 when neither was given.
+func (vs *viState) total() int {
+	n := vs.count
+	if vs.opCount > 0 {
+		if n == 0 {
+			n = vs.opCount
+		} else {
+			n *= vs.opCount
+		}
+	}
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
+// motionFunc computes the new dot after moving count times from dot in
+// line. inclusive marks motions (like "$" or "e") whose endpoint is part
+// of the text an operator acts on, as opposed to exclusive motions like
+// "w", whose endpoint is just past it.
+type motionFunc func(line string, dot, count int) (newDot int, inclusive bool)
+
+var motions = map[rune]motionFunc{
+	'h': func(line string, dot, count int) (int, bool) {
+		for ; count > 0 && dot > 0; count-- {
+			dot--
+		}
+		return dot, false
+	},
+	'l': func(line string, dot, count int) (int, bool) {
+		for ; count > 0 && dot < len(line); count-- {
+			dot++
+		}
+		return dot, false
+	},
+	'w': func(line string, dot, count int) (int, bool) {
+		for ; count > 0; count-- {
+			dot = nextWordStart(line, dot)
+		}
+		return dot, false
+	},
+	'b': func(line string, dot, count int) (int, bool) {
+		for ; count > 0; count-- {
+			dot = prevWordStart(line, dot)
+		}
+		return dot, false
+	},
+	'e': func(line string, dot, count int) (int, bool) {
+		for ; count > 0; count-- {
+			dot = wordEnd(line, dot)
+		}
+		return dot, true
+	},
+	'0': func(line string, dot, count int) (int, bool) { return 0, false },
+	'$': func(line string, dot, count int) (int, bool) { return len(line), true },
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func nextWordStart(line string, dot int) int {
+	i := dot
+	if i < len(line) {
+		word := isWordRune(rune(line[i]))
+		for i < len(line) && !unicode.IsSpace(rune(line[i])) && isWordRune(rune(line[i])) == word {
+			i++
+		}
+	}
+	for i < len(line) && unicode.IsSpace(rune(line[i])) {
+		i++
+	}
+	return i
+}
+
+func prevWordStart(line string, dot int) int {
+	i := dot
+	for i > 0 && unicode.IsSpace(rune(line[i-1])) {
+		i--
+	}
+	if i > 0 {
+		word := isWordRune(rune(line[i-1]))
+		for i > 0 && !unicode.IsSpace(rune(line[i-1])) && isWordRune(rune(line[i-1])) == word {
+			i--
+		}
+	}
+	return i
+}
+
+func wordEnd(line string, dot int) int {
+	i := dot + 1
+	for i < len(line) && unicode.IsSpace(rune(line[i])) {
+		i++
+	}
+	if i < len(line) {
+		word := isWordRune(rune(line[i]))
+		for i+1 < len(line) && !unicode.IsSpace(rune(line[i+1])) && isWordRune(rune(line[i+1])) == word {
+			i++
+		}
+	}
+	if i >= len(line) {
+		i = len(line) - 1
+	}
+	if i < dot {
+		i = dot
+	}
+	return i
+}
+
+// textObject resolves a text object such as "iw" or "a\"" to the [start,
+// end) range it spans around dot. kind is 'i' (inner) or 'a' (around).
+func textObject(line string, dot int, kind, obj rune) (start, end int, ok bool) {
+	switch obj {
+	case 'w':
+		start, end = wordObject(line, dot)
+	case '"', '\'', '`':
+		start, end, ok = quoteObject(line, dot, byte(obj))
+		if !ok {
+			return 0, 0, false
+		}
+	default:
+		return 0, 0, false
+	}
+	if kind == 'a' {
+		for end < len(line) && line[end] == ' ' {
+			end++
+		}
+	}
+	return start, end, true
+}
+
+func wordObject(line string, dot int) (start, end int) {
+	start, end = dot, dot
+	for start > 0 && isWordRune(rune(line[start-1])) {
+		start--
+	}
+	for end < len(line) && isWordRune(rune(line[end])) {
+		end++
+	}
+	if start == end {
+		end = dot + 1
+		if end > len(line) {
+			end = len(line)
+		}
+	}
+	return start, end
+}
+
+// quoteObject finds the pair of q quotes on line that surrounds dot. Since
+// a line can hold more than one quoted segment, quotes are paired up
+// left-to-right from the start of the line (there is no other way to tell
+// which side of a lone quote character is "inside"); the first pair whose
+// closing quote is at or after dot is the match -- which is either the
+// pair dot falls inside of, or, if dot is between two pairs or before the
+// first one, the next pair forward, matching real Vi. The opening quote
+// itself is excluded from the range.
+func quoteObject(line string, dot int, q byte) (start, end int, ok bool) {
+	i := 0
+	for i < len(line) {
+		if line[i] != q {
+			i++
+			continue
+		}
+		open := i
+		closeIdx := -1
+		for j := open + 1; j < len(line); j++ {
+			if line[j] == q {
+				closeIdx = j
+				break
+			}
+		}
+		if closeIdx == -1 {
+			// An unmatched quote can't start a pair, and every quote
+			// after it is inside what would be an unterminated string;
+			// there are no more complete pairs to find.
+			return 0, 0, false
+		}
+		if dot <= closeIdx {
+			return open + 1, closeIdx, true
+		}
+		i = closeIdx + 1
+	}
+	return 0, 0, false
+}
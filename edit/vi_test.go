@@ -0,0 +1,86 @@
+package edit
+
+import "testing"
+
+func TestMotions(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		dot      int
+		count    int
+		wantDot  int
+		wantIncl bool
+	}{
+		{"h", "abc", 2, 1, 1, false},
+		{"h stops at 0", "abc", 1, 5, 0, false},
+		{"l", "abc", 0, 1, 1, false},
+		{"l stops at end", "abc", 2, 5, 3, false},
+		{"w", "foo bar", 0, 1, 4, false},
+		{"w count", "foo bar baz", 0, 2, 8, false},
+		{"b", "foo bar", 4, 1, 0, false},
+		{"e", "foo bar", 0, 1, 2, true},
+		{"0", "foo bar", 5, 1, 0, false},
+		{"$", "foo bar", 0, 1, 7, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fn, ok := motions[rune(test.name[0])]
+			if !ok {
+				t.Fatalf("no motion for %q", test.name)
+			}
+			dot, incl := fn(test.line, test.dot, test.count)
+			if dot != test.wantDot || incl != test.wantIncl {
+				t.Errorf("got (%d, %v), want (%d, %v)", dot, incl, test.wantDot, test.wantIncl)
+			}
+		})
+	}
+}
+
+func TestWordObject(t *testing.T) {
+	tests := []struct {
+		line       string
+		dot        int
+		start, end int
+	}{
+		{"foo bar", 1, 0, 3},
+		{"foo bar", 4, 4, 7},
+		{"  x", 1, 1, 2},
+	}
+	for _, test := range tests {
+		start, end := wordObject(test.line, test.dot)
+		if start != test.start || end != test.end {
+			t.Errorf("wordObject(%q, %d) = (%d, %d), want (%d, %d)",
+				test.line, test.dot, start, end, test.start, test.end)
+		}
+	}
+}
+
+func TestQuoteObject(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		dot        int
+		q          byte
+		start, end int
+		ok         bool
+	}{
+		{"inside", `echo "hello"`, 7, '"', 6, 11, true},
+		{"before first quote", `echo "hello"`, 0, '"', 6, 11, true},
+		{"on opening quote", `echo "hello"`, 5, '"', 6, 11, true},
+		{"unmatched", `echo "hello`, 0, '"', 0, 0, false},
+		{"no quote at all", `echo hello`, 0, '"', 0, 0, false},
+		{"first of two segments", `echo "foo" "bar"`, 7, '"', 6, 9, true},
+		{"on closing quote of first segment", `echo "foo" "bar"`, 9, '"', 6, 9, true},
+		{"gap between two segments", `echo "foo" "bar"`, 10, '"', 12, 15, true},
+		{"second of two segments", `echo "foo" "bar"`, 13, '"', 12, 15, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end, ok := quoteObject(test.line, test.dot, test.q)
+			if ok != test.ok || (ok && (start != test.start || end != test.end)) {
+				t.Errorf("quoteObject(%q, %d, %q) = (%d, %d, %v), want (%d, %d, %v)",
+					test.line, test.dot, test.q, start, end, ok, test.start, test.end, test.ok)
+			}
+		})
+	}
+}
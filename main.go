@@ -0,0 +1,69 @@
+// Command elvish is the Elvish shell. -daemon and -connect expose the two
+// halves of the remote-editor protocol implemented in edit/remote.go:
+// "elvish -daemon <sock>" starts a long-lived daemon that owns the
+// Evaluator and history store and serves any number of concurrent
+// "elvish -connect <sock>" clients, each of which owns nothing but its
+// own terminal.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/xiaq/elvish/edit"
+	"github.com/xiaq/elvish/eval"
+	"github.com/xiaq/elvish/util"
+)
+
+var (
+	daemonSock  = flag.String("daemon", "", "run a remote-editor daemon listening on this socket")
+	connectSock = flag.String("connect", "", "connect to a remote-editor daemon listening on this socket")
+	histFname   = flag.String("history", "", "file to persist history to (daemon only)")
+)
+
+func main() {
+	flag.Parse()
+
+	switch {
+	case *daemonSock != "":
+		runDaemon(*daemonSock)
+	case *connectSock != "":
+		runClient(*connectSock)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: elvish -daemon <sock> | elvish -connect <sock>")
+		os.Exit(2)
+	}
+}
+
+func runDaemon(sock string) {
+	ev := eval.NewEvaluator()
+	prompt := func() string { return "> " }
+	rprompt := func() string { return "" }
+	if err := edit.RunDaemon(sock, *histFname, ev, prompt, rprompt); err != nil {
+		fmt.Fprintln(os.Stderr, "elvish -daemon:", err)
+		os.Exit(1)
+	}
+}
+
+// runClient connects to a daemon once and stays on that one connection for
+// every line of the session, printing each accepted line as RunClient
+// reports it; it exits if the connection is dropped, without reconnecting.
+func runClient(sock string) {
+	tr := util.NewTimedReader(os.Stdin)
+	err := edit.RunClient(os.Stdin, tr, sock, func(lr edit.LineRead) bool {
+		if lr.Err != nil {
+			fmt.Fprintln(os.Stderr, lr.Err)
+			os.Exit(1)
+		}
+		if lr.EOF {
+			return false
+		}
+		fmt.Println(lr.Line)
+		return true
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "elvish -connect:", err)
+		os.Exit(1)
+	}
+}